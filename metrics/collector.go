@@ -0,0 +1,107 @@
+// Copyright (C) 2024 Percona LLC
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// collectorTimeout bounds how long a single Collector gets to run before
+// CollectAll gives up on it and moves on.
+const collectorTimeout = 5 * time.Second
+
+// Collector gathers a named group of host metrics. Implementations should be
+// cheap to construct and safe to run concurrently with other collectors.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) (map[string]string, error)
+}
+
+var (
+	collectorsMu sync.Mutex
+	collectors   []Collector
+)
+
+// Register adds c to the set of collectors CollectAll drives. Built-in
+// collectors register themselves from init(); callers can add their own the
+// same way to extend ScrapeHostMetrics without touching this package.
+func Register(c Collector) {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+	collectors = append(collectors, c)
+}
+
+// CollectAll runs every registered Collector concurrently, each bounded by
+// collectorTimeout, and merges their results into a single map. A collector
+// that errors or times out is logged and skipped, so one bad collector can't
+// blank out the metrics the rest produced.
+func CollectAll(ctx context.Context) map[string]string {
+	collectorsMu.Lock()
+	toRun := make([]Collector, len(collectors))
+	copy(toRun, collectors)
+	collectorsMu.Unlock()
+
+	type result struct {
+		name    string
+		metrics map[string]string
+		err     error
+	}
+
+	results := make(chan result, len(toRun))
+	var wg sync.WaitGroup
+	for _, c := range toRun {
+		wg.Add(1)
+		go func(c Collector) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, collectorTimeout)
+			defer cancel()
+
+			done := make(chan result, 1)
+			go func() {
+				metrics, err := c.Collect(cctx)
+				done <- result{name: c.Name(), metrics: metrics, err: err}
+			}()
+
+			select {
+			case res := <-done:
+				results <- res
+			case <-cctx.Done():
+				results <- result{name: c.Name(), err: cctx.Err()}
+			}
+		}(c)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	merged := make(map[string]string)
+	for res := range results {
+		if res.err != nil {
+			zap.L().Sugar().Warnw("collector failed", zap.String("collector", res.name), zap.Error(res.err))
+			continue
+		}
+		for k, v := range res.metrics {
+			merged[k] = v
+		}
+	}
+	return merged
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2024 Percona LLC
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register(blockDeviceCollector{})
+}
+
+const sysBlockDir = "/sys/block"
+
+// blockDeviceCollector reports how many block devices are SSDs vs spinning
+// disks, per device's "queue/rotational" flag.
+type blockDeviceCollector struct{}
+
+func (blockDeviceCollector) Name() string { return "block_devices" }
+
+func (blockDeviceCollector) Collect(_ context.Context) (map[string]string, error) {
+	entries, err := os.ReadDir(sysBlockDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ssd, hdd int
+	for _, entry := range entries {
+		rotational := strings.TrimSpace(readFirstFile(filepath.Join(sysBlockDir, entry.Name(), "queue", "rotational")))
+		switch rotational {
+		case "0":
+			ssd++
+		case "1":
+			hdd++
+		}
+	}
+
+	m := make(map[string]string)
+	if ssd > 0 {
+		m["block_devices_ssd"] = strconv.Itoa(ssd)
+	}
+	if hdd > 0 {
+		m["block_devices_hdd"] = strconv.Itoa(hdd)
+	}
+	return m, nil
+}
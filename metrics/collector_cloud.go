@@ -0,0 +1,100 @@
+// Copyright (C) 2024 Percona LLC
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	Register(cloudCollector{})
+}
+
+// imdsTimeout bounds each individual cloud metadata probe so a host with no
+// network path to 169.254.169.254 doesn't stall the scrape.
+const imdsTimeout = 300 * time.Millisecond
+
+// DisableCloudMetadataProbe skips the cloud collector's IMDS probes
+// entirely. Set this on hosts where those link-local endpoints shouldn't be
+// reached at all (e.g. air-gapped environments) to avoid paying their
+// connection-timeout cost on every scrape.
+var DisableCloudMetadataProbe bool
+
+// cloudCollector reports "cloud_provider" (aws, gcp, or azure) by probing
+// each provider's instance metadata service. At most one of the probes is
+// expected to succeed on any given host.
+type cloudCollector struct{}
+
+func (cloudCollector) Name() string { return "cloud" }
+
+func (cloudCollector) Collect(ctx context.Context) (map[string]string, error) {
+	if DisableCloudMetadataProbe {
+		return nil, nil
+	}
+
+	for _, probe := range []func(context.Context) string{probeAWS, probeGCP, probeAzure} {
+		if provider := probe(ctx); provider != "" {
+			return map[string]string{"cloud_provider": provider}, nil
+		}
+	}
+	return nil, nil
+}
+
+func probeAWS(ctx context.Context) string {
+	return probeIMDS(ctx, "http://169.254.169.254/latest/meta-data/", nil, "aws")
+}
+
+func probeGCP(ctx context.Context) string {
+	return probeIMDS(ctx, "http://metadata.google.internal/computeMetadata/v1/", map[string]string{"Metadata-Flavor": "Google"}, "gcp")
+}
+
+func probeAzure(ctx context.Context) string {
+	return probeIMDS(ctx, "http://169.254.169.254/metadata/instance?api-version=2021-02-01", map[string]string{"Metadata": "true"}, "azure")
+}
+
+// probeIMDS issues a short-timeout GET against a cloud provider's instance
+// metadata endpoint and returns provider if it answers with HTTP 200.
+func probeIMDS(ctx context.Context, url string, headers map[string]string, provider string) string {
+	cctx, cancel := context.WithTimeout(ctx, imdsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(cctx, http.MethodGet, url, nil)
+	if err != nil {
+		return ""
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			zap.L().Sugar().Debugw("failed to close IMDS response body", zap.Error(cerr))
+		}
+	}()
+
+	if resp.StatusCode == http.StatusOK {
+		return provider
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2024 Percona LLC
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register(cpuCollector{})
+}
+
+// cpuCollector reports CPU topology: model name, socket and core counts
+// derived from /proc/cpuinfo, and NUMA node count from
+// /sys/devices/system/node.
+type cpuCollector struct{}
+
+func (cpuCollector) Name() string { return "cpu" }
+
+func (cpuCollector) Collect(_ context.Context) (map[string]string, error) {
+	info := parseCPUInfo(readFirstFile("/proc/cpuinfo"))
+
+	m := make(map[string]string)
+	if info.model != "" {
+		m["cpu_model"] = info.model
+	}
+	if info.sockets > 0 {
+		m["cpu_sockets"] = strconv.Itoa(info.sockets)
+	}
+	if info.cores > 0 {
+		m["cpu_cores"] = strconv.Itoa(info.cores)
+	}
+	if nodes := numaNodeCount(); nodes > 0 {
+		m["cpu_numa_nodes"] = strconv.Itoa(nodes)
+	}
+	return m, nil
+}
+
+type cpuInfo struct {
+	model   string
+	sockets int
+	cores   int
+}
+
+// parseCPUInfo walks /proc/cpuinfo's per-logical-CPU blocks (blank-line
+// separated) and counts distinct "physical id" values as sockets and
+// distinct "physical id"/"core id" pairs as cores.
+func parseCPUInfo(raw string) cpuInfo {
+	var info cpuInfo
+	sockets := make(map[string]struct{})
+	cores := make(map[string]struct{})
+
+	for _, block := range strings.Split(raw, "\n\n") {
+		var physicalID, coreID string
+		for _, line := range strings.Split(block, "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			key = strings.TrimSpace(key)
+			value = strings.TrimSpace(value)
+
+			switch key {
+			case "model name":
+				if info.model == "" {
+					info.model = value
+				}
+			case "physical id":
+				physicalID = value
+			case "core id":
+				coreID = value
+			}
+		}
+		if physicalID != "" {
+			sockets[physicalID] = struct{}{}
+		}
+		if physicalID != "" && coreID != "" {
+			cores[physicalID+"/"+coreID] = struct{}{}
+		}
+	}
+
+	info.sockets = len(sockets)
+	info.cores = len(cores)
+	return info
+}
+
+func numaNodeCount() int {
+	entries, err := os.ReadDir("/sys/devices/system/node")
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "node") {
+			count++
+		}
+	}
+	return count
+}
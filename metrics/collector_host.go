@@ -0,0 +1,89 @@
+// Copyright (C) 2024 Percona LLC
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	Register(osCollector{})
+	Register(hardwareCollector{})
+	Register(deploymentCollector{})
+	Register(kernelCollector{})
+}
+
+// osCollector reports the "OS" metric previously hard-coded into
+// ScrapeHostMetrics.
+type osCollector struct{}
+
+func (osCollector) Name() string { return "os" }
+
+func (osCollector) Collect(_ context.Context) (map[string]string, error) {
+	return map[string]string{"OS": getOSInfo()}, nil
+}
+
+// hardwareCollector reports the "hardware_arch" metric previously
+// hard-coded into ScrapeHostMetrics.
+type hardwareCollector struct{}
+
+func (hardwareCollector) Name() string { return "hardware" }
+
+func (hardwareCollector) Collect(_ context.Context) (map[string]string, error) {
+	return map[string]string{"hardware_arch": getHardwareInfo()}, nil
+}
+
+// deploymentCollector reports "deployment" and, when available,
+// "deployment_detail" (see getDeploymentInfo).
+type deploymentCollector struct{}
+
+func (deploymentCollector) Name() string { return "deployment" }
+
+func (deploymentCollector) Collect(_ context.Context) (map[string]string, error) {
+	deployment, detail := getDeploymentInfo()
+
+	m := map[string]string{"deployment": deployment}
+	if detail != "" {
+		m["deployment_detail"] = detail
+	}
+	return m, nil
+}
+
+// kernelCollector reports the running kernel release and boot command line.
+type kernelCollector struct{}
+
+func (kernelCollector) Name() string { return "kernel" }
+
+func (kernelCollector) Collect(ctx context.Context) (map[string]string, error) {
+	m := make(map[string]string)
+	if release := kernelRelease(ctx); release != "" {
+		m["kernel_release"] = release
+	}
+	if cmdline := strings.TrimSpace(readFirstFile("/proc/cmdline")); cmdline != "" {
+		m["kernel_cmdline"] = cmdline
+	}
+	return m, nil
+}
+
+func kernelRelease(ctx context.Context) string {
+	out, err := exec.CommandContext(ctx, "uname", "-r").Output() // #nosec G204
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2024 Percona LLC
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"strings"
+)
+
+func init() {
+	Register(memoryCollector{})
+}
+
+// meminfoMetrics maps the /proc/meminfo fields this collector reports to the
+// metric name they're published under.
+var meminfoMetrics = map[string]string{
+	"MemTotal":        "mem_total_kb",
+	"HugePages_Total": "mem_hugepages_total",
+	"Hugepagesize":    "mem_hugepage_size_kb",
+}
+
+// memoryCollector reports total memory and hugepage configuration from
+// /proc/meminfo.
+type memoryCollector struct{}
+
+func (memoryCollector) Name() string { return "memory" }
+
+func (memoryCollector) Collect(_ context.Context) (map[string]string, error) {
+	fields := parseMeminfo(readFirstFile("/proc/meminfo"))
+
+	m := make(map[string]string)
+	for field, metric := range meminfoMetrics {
+		if v, ok := fields[field]; ok {
+			m[metric] = v
+		}
+	}
+	return m, nil
+}
+
+// parseMeminfo parses /proc/meminfo's "Key:    value [unit]" lines into a
+// field-name to value map with the unit dropped, e.g. "MemTotal" -> "16336408".
+func parseMeminfo(raw string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(raw, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		valueFields := strings.Fields(value)
+		if len(valueFields) == 0 {
+			continue
+		}
+		fields[strings.TrimSpace(key)] = valueFields[0]
+	}
+	return fields
+}
@@ -16,7 +16,7 @@
 package metrics
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -29,50 +29,60 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	// dmiDir holds DMI strings the kernel exposes about the underlying
+	// hardware/hypervisor, used to tell virtualized and bare-metal hosts apart.
+	dmiDir = "/sys/class/dmi/id"
+
+	kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
 const (
 	telemetryFile = "/usr/local/percona/telemetry_uuid"
-	// key name in telemetryFile with host instance ID.
-	instanceIDKey = "instanceId"
+
+	// key names persisted in telemetryFile.
+	instanceIDKey   = "instanceId"
+	firstSeenKey    = "firstSeen"
+	agentVersionKey = "agentVersion"
 )
 
+// AgentVersion is the Telemetry Agent build version. It is overridden via
+// -ldflags at build time and persisted into the telemetry file so the
+// collector knows which agent version last reported for a given host.
+var AgentVersion = "unknown"
+
 // ScrapeHostMetrics gathers metrics about host where Telemetry Agent is running.
 // In addition, it checks Percona telemetry file and extracts instanceId value from it.
-func ScrapeHostMetrics() (*File, error) {
-	instanceID, err := getInstanceID(telemetryFile)
+// The bulk of the host metrics come from the registered Collectors (see
+// Register/CollectAll); each runs concurrently and a failing collector only
+// drops its own metrics rather than the whole scrape.
+func ScrapeHostMetrics(ctx context.Context) (*File, error) {
+	identity, err := getTelemetryIdentity(telemetryFile)
 	if err != nil {
-		return nil, fmt.Errorf("can't get Percona telemetry instanceID: %w", err)
+		return nil, fmt.Errorf("can't get Percona telemetry identity: %w", err)
 	}
 	m := &File{
 		Timestamp: time.Now(),
 		Filename:  telemetryFile,
 	}
 	m.Metrics = make(map[string]string)
-	m.Metrics[instanceIDKey] = instanceID
-
-	m.Metrics["OS"] = getOSInfo()
-	m.Metrics["deployment"] = getDeploymentInfo()
-	m.Metrics["hardware_arch"] = getHardwareInfo()
+	m.Metrics[instanceIDKey] = identity[instanceIDKey]
+	m.Metrics[firstSeenKey] = identity[firstSeenKey]
+	m.Metrics[agentVersionKey] = identity[agentVersionKey]
 
-	return m, nil
-}
-
-func customSplitFunc(data []byte, atEOF bool) (int, []byte, error) {
-	if atEOF && len(data) == 0 {
-		return 0, nil, nil
-	}
-
-	if atEOF {
-		return len(data), data, nil
+	for k, v := range CollectAll(ctx) {
+		m.Metrics[k] = v
 	}
 
-	if i := strings.Index(string(data), "\n"); i >= 0 {
-		// skip the delimiter in advancing to the next pair
-		return i + 1, data[0:i], nil
-	}
-	return 0, nil, nil
+	return m, nil
 }
 
-func getInstanceID(instanceFile string) (string, error) { //nolint:cyclop
+// getTelemetryIdentity reads the persistent per-host identity from
+// instanceFile, creating or backfilling it as needed, and returns it as a
+// field map. Besides instanceIDKey, it always ensures firstSeenKey (set once,
+// on first creation) and agentVersionKey (refreshed to AgentVersion on every
+// call) are present, while preserving any other keys already in the file.
+func getTelemetryIdentity(instanceFile string) (map[string]string, error) {
 	l := zap.L().Sugar().With(zap.String("file", instanceFile))
 	l.Debug("processing Percona telemetry file")
 
@@ -82,76 +92,216 @@ func getInstanceID(instanceFile string) (string, error) { //nolint:cyclop
 	// example:
 	// "instanceId: 1bed5f0d-cc3a-11ee-bd8a-c84bd64e0277".
 	cleanInstanceFile := filepath.Clean(instanceFile)
-	dirName := filepath.Dir(cleanInstanceFile)
-	_, err := os.Stat(dirName)
-	if os.IsNotExist(err) {
-		// directory is absent, creating
-		if err := os.MkdirAll(dirName, os.ModePerm); err != nil {
-			l.Errorw("can't create directory",
-				zap.String("directory", dirName),
-				zap.Error(err))
-			return "", err
-		}
-		return createTelemetryFile(cleanInstanceFile)
+	if err := os.MkdirAll(filepath.Dir(cleanInstanceFile), os.ModePerm); err != nil {
+		l.Errorw("can't create directory", zap.String("directory", filepath.Dir(cleanInstanceFile)), zap.Error(err))
+		return nil, err
 	}
 
-	var instanceID string
-
-	file, err := os.Open(cleanInstanceFile)
-	// do not forget to close file.
-	defer func(file *os.File, fl *zap.SugaredLogger) {
-		err := file.Close()
-		if err != nil {
-			fl.Errorw("failed to close Percona telemetry file", zap.Error(err))
-		}
-	}(file, l)
-
+	fields, err := ReadTelemetryFile(cleanInstanceFile)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			l.Errorw("failed to read Percona telemetry file, skipping", zap.Error(err))
-			return "", err
+			return nil, err
 		}
-		// telemetry file is absent, fill values on our own
-		// and write back to file.
-		return createTelemetryFile(cleanInstanceFile)
-	} else if st, err := file.Stat(); err != nil {
-		l.Errorw("failed to get file info", zap.Error(err))
-		return "", err
-	} else if st.Size() == 0 {
-		// file exists but is empty
-		return createTelemetryFile(cleanInstanceFile)
-	}
-
-	// file exists and is not empty.
-	// get "instanceID" value from file.
-	scanner := bufio.NewScanner(file)
-	scanner.Split(customSplitFunc)
-	for scanner.Scan() {
-		if parts := strings.Split(scanner.Text(), ":"); len(parts) == 2 && parts[0] == instanceIDKey {
-			instanceID = strings.TrimSpace(parts[1])
-			break
+		// telemetry file is absent, fields will be filled in below.
+		fields = make(map[string]string)
+	}
+
+	changed := false
+	if fields[instanceIDKey] == "" {
+		fields[instanceIDKey] = uuid.New().String()
+		changed = true
+	}
+	if fields[firstSeenKey] == "" {
+		fields[firstSeenKey] = time.Now().UTC().Format(time.RFC3339)
+		changed = true
+	}
+	if fields[agentVersionKey] != AgentVersion {
+		fields[agentVersionKey] = AgentVersion
+		changed = true
+	}
+
+	if changed {
+		if err := WriteTelemetryFile(cleanInstanceFile, fields); err != nil {
+			l.Errorw("failed to write Percona telemetry file", zap.Error(err))
+			return nil, err
 		}
 	}
 
-	if len(instanceID) == 0 {
+	if fields[instanceIDKey] == "" {
 		l.Error("failed to get Percona telemetry instanceID, it is empty")
 	}
-	return instanceID, nil
+	return fields, nil
+}
+
+// getDeploymentInfo classifies the environment Telemetry Agent runs in. It
+// returns a coarse deployment kind (one of PACKAGE, DOCKER, PODMAN,
+// KUBERNETES, LXC, SYSTEMD_NSPAWN, VM_KVM, VM_VMWARE, VM_HYPERV, VM_XEN,
+// BAREMETAL) and, for KUBERNETES only, a detail: "gke", "eks" or "aks" when
+// the DMI strings name the cloud provider (see detectKubernetesFlavor),
+// otherwise "no-serviceaccount-token" when the ServiceAccount token mount is
+// absent, otherwise "". OpenShift and other distributions are not detected.
+func getDeploymentInfo() (deployment, detail string) {
+	if dep, det, ok := detectContainer(); ok {
+		return dep, det
+	}
+
+	if vmKind, ok := detectHypervisorVendor(); ok {
+		return vmKind, ""
+	}
+
+	if cpuinfoHasHypervisorFlag() {
+		// Virtualized, but the DMI strings didn't give away the hypervisor
+		// vendor. Rather than guess, fall back to the legacy default.
+		return "PACKAGE", ""
+	}
+
+	if dmiString("sys_vendor") != "" || dmiString("product_name") != "" {
+		// DMI info was actually read and shows neither a hypervisor nor any
+		// of the signals above, so this looks like real hardware.
+		return "BAREMETAL", ""
+	}
+
+	return "PACKAGE", ""
+}
+
+// detectContainer looks for container/orchestrator signals, in order from
+// most to least specific.
+func detectContainer() (deployment, detail string, ok bool) {
+	if isKubernetes() {
+		detail := detectKubernetesFlavor()
+		if detail == "" && !fileExists(kubernetesServiceAccountDir) {
+			// automountServiceAccountToken: false is common hardening practice;
+			// KUBERNETES_SERVICE_HOST alone is still a reliable enough signal,
+			// this just flags that the usual corroborating mount is absent.
+			detail = "no-serviceaccount-token"
+		}
+		return "KUBERNETES", detail, true
+	}
+
+	if fileExists("/run/.containerenv") {
+		return "PODMAN", "", true
+	}
+	if fileExists("/.dockerenv") {
+		return "DOCKER", "", true
+	}
+
+	cgroup := readFirstFile("/proc/1/cgroup", "/proc/self/cgroup")
+	switch {
+	case strings.Contains(cgroup, "docker"):
+		return "DOCKER", "", true
+	case strings.Contains(cgroup, "podman"):
+		return "PODMAN", "", true
+	case strings.Contains(cgroup, "lxc"):
+		return "LXC", "", true
+	}
+
+	switch containerKind := strings.ToLower(strings.TrimSpace(os.Getenv("container"))); containerKind {
+	case "docker":
+		return "DOCKER", "", true
+	case "podman":
+		return "PODMAN", "", true
+	case "lxc":
+		return "LXC", "", true
+	case "systemd-nspawn":
+		return "SYSTEMD_NSPAWN", "", true
+	}
+
+	switch strings.ToLower(strings.TrimSpace(readFirstFile("/run/systemd/container"))) {
+	case "docker":
+		return "DOCKER", "", true
+	case "lxc":
+		return "LXC", "", true
+	case "systemd-nspawn":
+		return "SYSTEMD_NSPAWN", "", true
+	}
+
+	return "", "", false
+}
+
+// isKubernetes checks for KUBERNETES_SERVICE_HOST, the env var the kubelet
+// injects into every pod. The ServiceAccount token directory is also usually
+// mounted, but pods run with automountServiceAccountToken: false (a common
+// hardening practice) won't have it, so its absence alone must not override
+// this signal; see detectContainer for how it's used to enrich the detail.
+func isKubernetes() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
 }
 
-func createTelemetryFile(instanceFile string) (string, error) {
-	instanceID := uuid.New().String()
-	if err := os.WriteFile(instanceFile, []byte(fmt.Sprintf("%s: %s", instanceIDKey, instanceID)), 0o600); err != nil {
-		zap.L().Sugar().With(zap.String("file", instanceFile)).
-			Errorw("failed to write Percona telemetry file", zap.Error(err))
-		return "", err
+// detectKubernetesFlavor makes a best-effort guess at the specific managed
+// Kubernetes product from DMI strings set by the underlying cloud provider's
+// hypervisor. It returns "" when nothing more specific can be derived.
+func detectKubernetesFlavor() string {
+	vendor := strings.ToLower(dmiString("sys_vendor") + " " + dmiString("product_name"))
+
+	switch {
+	case strings.Contains(vendor, "google"):
+		return "gke"
+	case strings.Contains(vendor, "amazon"):
+		return "eks"
+	case strings.Contains(vendor, "microsoft"):
+		return "aks"
+	}
+	return ""
+}
+
+// detectHypervisorVendor maps DMI sys_vendor/product_name strings to the
+// hypervisor that presents them. It returns ok=false when nothing matched,
+// which does not necessarily mean the host isn't virtualized.
+func detectHypervisorVendor() (string, bool) {
+	combined := strings.ToLower(dmiString("sys_vendor") + " " + dmiString("product_name"))
+
+	switch {
+	case strings.Contains(combined, "qemu"), strings.Contains(combined, "kvm"):
+		return "VM_KVM", true
+	case strings.Contains(combined, "vmware"):
+		return "VM_VMWARE", true
+	case strings.Contains(combined, "microsoft corporation"):
+		return "VM_HYPERV", true
+	case strings.Contains(combined, "xen"):
+		return "VM_XEN", true
+	}
+	return "", false
+}
+
+// cpuinfoHasHypervisorFlag reports whether the CPU advertises the
+// "hypervisor" feature flag, i.e. the kernel believes it's running under
+// some hypervisor.
+func cpuinfoHasHypervisorFlag() bool {
+	for _, line := range strings.Split(readFirstFile("/proc/cpuinfo"), "\n") {
+		if !strings.HasPrefix(line, "flags") {
+			continue
+		}
+		for _, flag := range strings.Fields(line) {
+			if flag == "hypervisor" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dmiString reads a single DMI identity string (e.g. "sys_vendor",
+// "product_name") and returns "" if it isn't exposed on this host.
+func dmiString(field string) string {
+	return strings.TrimSpace(readFirstFile(filepath.Join(dmiDir, field)))
+}
+
+// readFirstFile returns the contents of the first path that can be read, or
+// "" if none can.
+func readFirstFile(paths ...string) string {
+	for _, path := range paths {
+		if data, err := os.ReadFile(path); err == nil { // #nosec G304
+			return string(data)
+		}
 	}
-	return instanceID, nil
+	return ""
 }
 
-func getDeploymentInfo() string {
-	// TODO: determine environment
-	return "PACKAGE"
+// fileExists reports whether path can be stat'd.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
 
 func getOSInfo() string {
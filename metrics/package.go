@@ -16,10 +16,9 @@
 package metrics
 
 import (
-	"bufio"
 	"context"
-	"errors"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -30,55 +29,114 @@ const (
 	pkgResultTimeout = 30 * time.Second
 )
 
-var errPackageNotFound = errors.New("package is not found")
-
 // NOTE: the logic in this file is designed in a way "do our best to provide value", i.e. in case an error appears
 // it is not passed to upper level but is just printed into log stream and fallback value is applied.
 
-// Package represents a software package with its name and version.
+// Package represents a software package with its name and version, plus the
+// NEVRA (Name-Epoch-Version-Release-Arch) fields split out so downstream
+// telemetry consumers don't have to re-parse a concatenated version string.
 type Package struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
+	Epoch   string `json:"epoch,omitempty"`
+	Release string `json:"release,omitempty"`
+	Arch    string `json:"arch,omitempty"`
+
+	// SourceName and SourceVersion identify the source package this binary
+	// package was built from (e.g. the SRPM or the dpkg "Source:" field).
+	SourceName    string `json:"source_name,omitempty"`
+	SourceVersion string `json:"source_version,omitempty"`
+
+	// Parent points at another *Package reported from the same source
+	// package, so binary splits (server/client/debuginfo, ...) can be
+	// collapsed back to a single build. It is not serialized directly since
+	// the source fields above already carry the correlation.
+	Parent *Package `json:"-"`
+
+	// Packager is populated by backends that report it directly (pacman);
+	// it is left empty otherwise.
+	Packager string `json:"packager,omitempty"`
 }
 
-// queryPkgFunc represents a function type for querying package information from particular package manager (dpkg or rpm).
-type queryPkgFunc func(ctx context.Context, packageName string) (*Package, error)
+// bulkQueryFunc queries every installed package known to a package manager in
+// a single call and returns them keyed by package name.
+type bulkQueryFunc func(ctx context.Context) (map[string]*Package, error)
 
-// ScrapeInstalledPackages scrapes the installed packages on the host and returns a slice of Package structs along with any errors encountered.
-// The function uses the localOs variable to determine the package manager to use.
-func ScrapeInstalledPackages(ctx context.Context) []*Package {
-	pkgList := getCommonPackages()
+// ScrapeInstalledPackages looks up names among the packages installed on the
+// host and returns the ones that are found. If names is empty, it falls back
+// to DefaultPackageNames for the host's package manager family.
+//
+// Every package manager is queried exactly once per call (see queryDpkgBulk,
+// queryRpmBulk, queryPacmanBulk), so the cost of this function no longer
+// scales with len(names).
+func ScrapeInstalledPackages(ctx context.Context, names []string) []*Package {
 	localOs := getOSInfo()
+	if len(names) == 0 {
+		names = DefaultPackageNames(localOs)
+	}
 
-	toReturn := make([]*Package, 0, 1)
-	var pkgFunc queryPkgFunc
+	var bulkFunc bulkQueryFunc
+	switch {
+	case isDebianFamily(localOs):
+		bulkFunc = queryDpkgBulk
+	case isRHELFamily(localOs):
+		bulkFunc = queryRpmBulk
+	case isArchFamily(localOs):
+		bulkFunc = queryPacmanBulk
+	default:
+		zap.L().Sugar().Warnw("unsupported package system", zap.String("OS", localOs))
+		return nil
+	}
+
+	installed, err := bulkFunc(ctx)
+	if err != nil {
+		zap.L().Sugar().Warnw("failed to query installed packages", zap.Error(err))
+		return nil
+	}
+
+	toReturn := make([]*Package, 0, len(names))
+	for _, name := range names {
+		if pkg, ok := installed[name]; ok {
+			toReturn = append(toReturn, pkg)
+		}
+	}
+	linkSourcePackages(toReturn)
+	return toReturn
+}
+
+// DefaultPackageNames returns Percona's own hard-coded package name list for
+// the host's package manager family, used when ScrapeInstalledPackages is
+// called without an explicit name list.
+func DefaultPackageNames(localOs string) []string {
+	pkgList := getCommonPackages()
 
 	switch {
 	case isDebianFamily(localOs):
-		pkgFunc = queryDpkg
 		pkgList = append(pkgList, getDebianPackages()...)
 	case isRHELFamily(localOs):
-		pkgFunc = queryRpm
 		pkgList = append(pkgList, getRhelPackages()...)
-	default:
-		zap.L().Sugar().Warnw("unsupported package system", zap.String("OS", localOs))
-		return toReturn
+	case isArchFamily(localOs):
+		pkgList = append(pkgList, getArchPackages()...)
 	}
+	return pkgList
+}
 
-	var pkg *Package
-	var err error
-	for _, pName := range pkgList {
-		if pkg, err = pkgFunc(ctx, pName); err != nil {
-			if !errors.Is(err, errPackageNotFound) {
-				zap.L().Sugar().Warnw("failed to get package info", zap.Error(err), zap.String("package", pName))
-			}
-			// go to next package silently
+// linkSourcePackages sets Parent on every package that shares its SourceName
+// with an earlier package in pkgs, so binary splits built from the same
+// source (server/client/debuginfo, ...) collapse under a single parent.
+func linkSourcePackages(pkgs []*Package) {
+	bySource := make(map[string]*Package, len(pkgs))
+	for _, pkg := range pkgs {
+		if pkg.SourceName == "" {
+			continue
+		}
+		parent, ok := bySource[pkg.SourceName]
+		if !ok {
+			bySource[pkg.SourceName] = pkg
 			continue
 		}
-		// package is installed
-		toReturn = append(toReturn, pkg)
+		pkg.Parent = parent
 	}
-	return toReturn
 }
 
 func isDebianFamily(name string) bool {
@@ -105,157 +163,154 @@ func isRHELFamily(name string) bool {
 	return false
 }
 
-func queryDpkg(ctx context.Context, packageName string) (*Package, error) {
-	args := []string{"dpkg-query", "-f", "'${Package} ${db:Status-Abbrev}${Version}'", "-W", packageName}
-	zap.L().Sugar().Debugw("executing command", zap.String("cmd", strings.Join(args, " ")))
-
-	cmdCtx, cancel := context.WithTimeout(ctx, pkgResultTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(cmdCtx, args[0], args[1:]...) // #nosec G204
-	outputB, err := cmd.CombinedOutput()
-	return parseDpkgOutput(packageName, string(outputB), err)
-}
+func isArchFamily(name string) bool {
+	nameL := strings.ToLower(name)
+	prefixes := []string{"arch", "manjaro", "endeavouros", "garuda"}
 
-func parseDpkgOutput(packageName, dpkgOutput string, dpkgErr error) (*Package, error) { //nolint:cyclop
-	if dpkgErr != nil {
-		if strings.Contains(dpkgOutput, "no packages found matching") {
-			// package is not installed
-			return nil, errPackageNotFound
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(nameL, prefix) {
+			return true
 		}
-
-		zap.L().Sugar().Debugw("cmd output", zap.String("output", dpkgOutput))
-		return nil, dpkgErr
 	}
+	return false
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(dpkgOutput))
-
-	var version string
-	for scanner.Scan() {
-		// trim spaces and single quote chars
-		line := strings.Trim(scanner.Text(), " '")
-		if len(line) == 0 {
-			continue
-		}
-
-		tokens := strings.Split(line, " ")
-		// The successful line for package shall be in format:
-		// <package name> <status> [epoch:]<version>.
-		// Example:
-		// 'percona-xtrabackup-81 ii 8.1.0-1-1.jammy'
-		// or with epoch:
-		// 'percona-xtrabackup-81 ii 2:8.1.0-1-1.jammy'
-		if len(tokens) != 3 {
-			continue
-		}
-
-		if tokens[0] != packageName {
-			continue
-		}
-
-		if tokens[1] == "ii" {
-			version = tokens[2]
-			// need to trim extra chars from release part.
-			if pos := strings.LastIndex(version, "."); pos != -1 {
-				version = version[0:pos]
-			}
-			// need to trim epoch part if it is present.
-			if pos := strings.Index(version, ":"); pos != -1 {
-				version = version[pos+1:]
-			}
-			// need to trim +dfsg part if it is present.
-			if pos := strings.Index(version, "+dfsg"); pos != -1 {
-				version = version[0:pos]
-			}
-			break
-		}
+// normalizeDpkgVersion splits dpkg's combined
+// "[epoch:]upstream_version[-debian_revision]" version string into its
+// epoch, upstream version and debian revision (reported as Release) parts,
+// shared by both the exec and directdb dpkg backends.
+func normalizeDpkgVersion(raw string) (version, epoch, release string) {
+	rest := raw
+	// need to split off the epoch part if it is present.
+	if pos := strings.Index(rest, ":"); pos != -1 {
+		epoch = rest[0:pos]
+		rest = rest[pos+1:]
 	}
 
-	if err := scanner.Err(); err != nil {
-		zap.L().Sugar().Warnw("failed to read output from dpkg-query", zap.Error(err))
-		return nil, err
+	// split off the debian revision before trimming +dfsg, otherwise a
+	// "+dfsg" occurring before the last "-" would eat the revision along
+	// with it (e.g. "8.0.36+dfsg-1" must keep release="1").
+	version = rest
+	if pos := strings.LastIndex(rest, "-"); pos != -1 {
+		version = rest[0:pos]
+		release = rest[pos+1:]
 	}
 
-	if len(version) > 0 {
-		return &Package{
-			Name:    packageName,
-			Version: version,
-		}, nil
+	// need to trim +dfsg part if it is present.
+	if pos := strings.Index(version, "+dfsg"); pos != -1 {
+		version = version[0:pos]
 	}
 
-	// no installed packaged found
-	return nil, errPackageNotFound
+	return version, epoch, release
 }
 
-func queryRpm(ctx context.Context, packageName string) (*Package, error) {
-	args := []string{"rpm", "-q", packageName, "--queryformat", "'%{NAME} %{VERSION} %{RELEASE}'"}
-	zap.L().Sugar().Debugw("executing command", zap.String("cmd", strings.Join(args, " ")))
+// parseDpkgSource splits a dpkg "Source" field value, which is either empty
+// (source name equals the binary package name), a bare source name, or
+// "name (version)" when the source package version differs from the binary.
+func parseDpkgSource(raw, packageName string) (name, version string) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return packageName, ""
+	}
+	if pos := strings.Index(raw, "("); pos != -1 {
+		name = strings.TrimSpace(raw[:pos])
+		version = strings.Trim(raw[pos:], "() ")
+		return name, version
+	}
+	return raw, ""
+}
 
-	cmdCtx, cancel := context.WithTimeout(ctx, pkgResultTimeout)
-	defer cancel()
+// parseSourceRPM recovers the source package Name-Version-Release from an
+// SRPM filename such as "percona-xtrabackup-81-8.1.0-1.1.el8.src.rpm". rpm
+// doesn't split the SOURCERPM tag into its components, so it has to be
+// parsed back out: the last two dash-separated segments are release and
+// version, everything before that is the name.
+func parseSourceRPM(srpm string) (name, version, release string) {
+	s := strings.TrimSuffix(srpm, ".rpm")
+	s = strings.TrimSuffix(s, ".src")
+
+	releaseIdx := strings.LastIndex(s, "-")
+	if releaseIdx == -1 {
+		return s, "", ""
+	}
+	release = s[releaseIdx+1:]
+	rest := s[:releaseIdx]
 
-	cmd := exec.CommandContext(cmdCtx, args[0], args[1:]...) // #nosec G204
-	outputB, err := cmd.CombinedOutput()
-	return parseRpmOutput(packageName, string(outputB), err)
+	versionIdx := strings.LastIndex(rest, "-")
+	if versionIdx == -1 {
+		return rest, "", release
+	}
+	name = rest[:versionIdx]
+	version = rest[versionIdx+1:]
+	return name, version, release
 }
 
-func parseRpmOutput(packageName, rpmOutput string, rpmErr error) (*Package, error) {
-	if rpmErr != nil {
-		if strings.Contains(rpmOutput, "is not installed") {
-			// package is not installed
-			return nil, errPackageNotFound
+// pacmanLocalDB is the pacman local package database directory. Every
+// installed package has a "<name>-<version>-<pkgrel>" subdirectory there
+// holding a "desc" file with the package metadata.
+const pacmanLocalDB = "/var/lib/pacman/local"
+
+// queryPacmanBulk reads every package's "desc" file directly under
+// pacmanLocalDB instead of shelling out to "pacman -Qi" once per package.
+func queryPacmanBulk(_ context.Context) (map[string]*Package, error) {
+	entries, err := os.ReadDir(pacmanLocalDB)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]*Package{}, nil
 		}
-
-		zap.L().Sugar().Debugw("cmd output", zap.String("output", rpmOutput))
-		return nil, rpmErr
+		return nil, err
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(rpmOutput))
-
-	var version string
-	for scanner.Scan() {
-		line := strings.Trim(scanner.Text(), " '")
-		if len(line) == 0 {
+	pkgs := make(map[string]*Package, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
 			continue
 		}
 
-		tokens := strings.Split(line, " ")
-		// The successful line for package shall be in format:
-		// <package name> <version> <release>.
-		// Example:
-		// 'percona-xtrabackup-81 8.1.0 1.1.el8'
-		if len(tokens) != 3 {
+		descPath := filepath.Join(pacmanLocalDB, entry.Name(), "desc")
+		fields, err := parsePacmanDesc(descPath)
+		if err != nil {
+			zap.L().Sugar().Debugw("failed to read pacman desc", zap.Error(err), zap.String("path", descPath))
 			continue
 		}
 
-		if tokens[0] != packageName {
+		name := fields["NAME"]
+		if name == "" {
 			continue
 		}
-		release := tokens[2]
-		// need to trim extra chars from release part
-		if pos := strings.LastIndex(release, "."); pos != -1 {
-			release = release[0:pos]
+		pkgs[name] = &Package{
+			Name:     name,
+			Version:  fields["VERSION"],
+			Arch:     fields["ARCH"],
+			Packager: fields["PACKAGER"],
 		}
-
-		release = strings.ReplaceAll(release, ".", "-")
-
-		version = strings.Join([]string{tokens[1], release}, "-")
-		break
 	}
+	return pkgs, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		zap.L().Sugar().Warnw("failed to read output from rpm", zap.Error(err))
+// parsePacmanDesc reads a pacman "desc" file, which is a series of
+// %FIELD%\nvalue\n\n blocks, and returns it as a field-name to value map.
+func parsePacmanDesc(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
 		return nil, err
 	}
 
-	if len(version) > 0 {
-		return &Package{
-			Name:    packageName,
-			Version: version,
-		}, nil
+	fields := make(map[string]string)
+	for _, section := range strings.Split(string(data), "\n\n") {
+		section = strings.TrimSpace(section)
+		if section == "" {
+			continue
+		}
+
+		lines := strings.SplitN(section, "\n", 2)
+		if len(lines) != 2 {
+			continue
+		}
+		key := strings.Trim(lines[0], "%")
+		fields[key] = strings.TrimSpace(lines[1])
 	}
-	// package is not installed
-	return nil, errPackageNotFound
+	return fields, nil
 }
 
 // getDebianPackages returns list of Percona's Debian specific package names.
@@ -284,6 +339,21 @@ func getRhelPackages() []string {
 	}
 }
 
+// getArchPackages returns list of Percona's Arch Linux specific package names.
+func getArchPackages() []string {
+	return []string{
+		// PS + PXC packages
+		"percona-server",
+		"percona-xtradb-cluster",
+		// PG
+		"percona-postgresql",
+		// PXB
+		"percona-xtrabackup",
+		// Percona Toolkit
+		"percona-toolkit",
+	}
+}
+
 // getCommonPackages returns list of Percona packages that have the same names both on Debian and RHEL systems.
 func getCommonPackages() []string {
 	return []string{
@@ -323,4 +393,4 @@ func getCommonPackages() []string {
 		// Telemetry Agent
 		"percona-telemetry-agent",
 	}
-}
\ No newline at end of file
+}
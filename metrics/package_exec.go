@@ -0,0 +1,139 @@
+// Copyright (C) 2024 Percona LLC
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !directdb
+
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// queryDpkgBulk lists every installed dpkg package with a single
+// dpkg-query invocation. Built by default; build with -tags directdb to
+// read /var/lib/dpkg/status directly instead.
+func queryDpkgBulk(ctx context.Context) (map[string]*Package, error) {
+	args := []string{"dpkg-query", "-W", "-f", "${Package}\t${Source}\t${Version}\t${Architecture}\t${db:Status-Abbrev}\n"}
+	zap.L().Sugar().Debugw("executing command", zap.String("cmd", strings.Join(args, " ")))
+
+	cmdCtx, cancel := context.WithTimeout(ctx, pkgResultTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(cmdCtx, args[0], args[1:]...) // #nosec G204
+	outputB, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("dpkg-query failed: %w", err)
+	}
+	return parseDpkgBulkOutput(string(outputB)), nil
+}
+
+func parseDpkgBulkOutput(output string) map[string]*Package {
+	pkgs := make(map[string]*Package)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+
+		// Each line shall be in format:
+		// <package> <source> [epoch:]<version>[.distro] <arch> <status>.
+		// Example:
+		// 'percona-xtrabackup-81	percona-xtrabackup	8.1.0-1.1.jammy	amd64	ii'
+		fields := strings.Split(line, "\t")
+		// ${db:Status-Abbrev} is three characters wide; the third (error flag)
+		// is a space when there is no error, hence the TrimSpace.
+		if len(fields) != 5 || strings.TrimSpace(fields[4]) != "ii" {
+			continue
+		}
+
+		name := fields[0]
+		sourceName, sourceVersion := parseDpkgSource(fields[1], name)
+		version, epoch, release := normalizeDpkgVersion(fields[2])
+		pkgs[name] = &Package{
+			Name:          name,
+			Version:       version,
+			Epoch:         epoch,
+			Release:       release,
+			Arch:          fields[3],
+			SourceName:    sourceName,
+			SourceVersion: sourceVersion,
+		}
+	}
+	return pkgs
+}
+
+// queryRpmBulk lists every installed rpm package with a single "rpm -qa"
+// invocation. Built by default; build with -tags directdb to read the RPM
+// database directly instead.
+func queryRpmBulk(ctx context.Context) (map[string]*Package, error) {
+	args := []string{"rpm", "-qa", "--qf", "%{NAME}\t%{VERSION}\t%{RELEASE}\t%{EPOCH}\t%{ARCH}\t%{SOURCERPM}\n"}
+	zap.L().Sugar().Debugw("executing command", zap.String("cmd", strings.Join(args, " ")))
+
+	cmdCtx, cancel := context.WithTimeout(ctx, pkgResultTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(cmdCtx, args[0], args[1:]...) // #nosec G204
+	outputB, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("rpm -qa failed: %w", err)
+	}
+	return parseRpmBulkOutput(string(outputB)), nil
+}
+
+func parseRpmBulkOutput(output string) map[string]*Package {
+	pkgs := make(map[string]*Package)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+
+		// Each line shall be in format:
+		// <name> <version> <release> <epoch> <arch> <sourcerpm>.
+		// Example:
+		// 'percona-xtrabackup-81	8.1.0	1.1.el8	(none)	x86_64	percona-xtrabackup-81-8.1.0-1.1.el8.src.rpm'
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			continue
+		}
+
+		name := fields[0]
+		var epoch string
+		if fields[3] != "(none)" {
+			epoch = fields[3]
+		}
+		sourceName, sourceVersion, _ := parseSourceRPM(fields[5])
+		pkgs[name] = &Package{
+			Name:          name,
+			Version:       fields[1],
+			Epoch:         epoch,
+			Release:       fields[2],
+			Arch:          fields[4],
+			SourceName:    sourceName,
+			SourceVersion: sourceVersion,
+		}
+	}
+	return pkgs
+}
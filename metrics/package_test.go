@@ -0,0 +1,116 @@
+// Copyright (C) 2024 Percona LLC
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import "testing"
+
+func TestNormalizeDpkgVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		wantVersion string
+		wantEpoch   string
+		wantRelease string
+	}{
+		{
+			name:        "plain version and release",
+			raw:         "8.1.0-1.1.jammy",
+			wantVersion: "8.1.0",
+			wantRelease: "1.1.jammy",
+		},
+		{
+			name:        "epoch, version and release",
+			raw:         "2:1.2.3-4",
+			wantEpoch:   "2",
+			wantVersion: "1.2.3",
+			wantRelease: "4",
+		},
+		{
+			name:        "+dfsg suffix must not eat the release",
+			raw:         "8.0.36+dfsg-1",
+			wantVersion: "8.0.36",
+			wantRelease: "1",
+		},
+		{
+			name:        "epoch and +dfsg suffix together",
+			raw:         "2:1.2.3+dfsg-1",
+			wantEpoch:   "2",
+			wantVersion: "1.2.3",
+			wantRelease: "1",
+		},
+		{
+			name:        "multi-dash upstream version keeps only the last dash as release",
+			raw:         "1.2.3-beta-4",
+			wantVersion: "1.2.3-beta",
+			wantRelease: "4",
+		},
+		{
+			name:        "no release",
+			raw:         "1.2.3",
+			wantVersion: "1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, epoch, release := normalizeDpkgVersion(tt.raw)
+			if version != tt.wantVersion || epoch != tt.wantEpoch || release != tt.wantRelease {
+				t.Errorf("normalizeDpkgVersion(%q) = (%q, %q, %q), want (%q, %q, %q)",
+					tt.raw, version, epoch, release, tt.wantVersion, tt.wantEpoch, tt.wantRelease)
+			}
+		})
+	}
+}
+
+func TestParseSourceRPM(t *testing.T) {
+	tests := []struct {
+		name        string
+		srpm        string
+		wantName    string
+		wantVersion string
+		wantRelease string
+	}{
+		{
+			name:        "typical srpm filename",
+			srpm:        "percona-xtrabackup-81-8.1.0-1.1.el8.src.rpm",
+			wantName:    "percona-xtrabackup-81",
+			wantVersion: "8.1.0",
+			wantRelease: "1.1.el8",
+		},
+		{
+			name:        "multi-dash package name",
+			srpm:        "percona-server-server-8.0.36-28.1.el9.src.rpm",
+			wantName:    "percona-server-server",
+			wantVersion: "8.0.36",
+			wantRelease: "28.1.el9",
+		},
+		{
+			name:     "no dashes at all",
+			srpm:     "noversion.src.rpm",
+			wantName: "noversion",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, version, release := parseSourceRPM(tt.srpm)
+			if name != tt.wantName || version != tt.wantVersion || release != tt.wantRelease {
+				t.Errorf("parseSourceRPM(%q) = (%q, %q, %q), want (%q, %q, %q)",
+					tt.srpm, name, version, release, tt.wantName, tt.wantVersion, tt.wantRelease)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2024 Percona LLC
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ReadTelemetryFile reads a Percona telemetry key-value file (such as
+// telemetryFile) and returns its contents as a map. Lines are of the form
+// "key: value"; comments ("#...") and blank lines are ignored, and both LF
+// and CRLF line endings are accepted. Unknown keys are preserved so callers
+// can round-trip them back out via WriteTelemetryFile.
+func ReadTelemetryFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	return parseTelemetryFile(data), nil
+}
+
+func parseTelemetryFile(data []byte) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		fields[key] = strings.TrimSpace(value)
+	}
+	return fields
+}
+
+// WriteTelemetryFile writes fields out as one "key: value" line per entry,
+// sorted by key for a stable, diff-friendly file. It is the counterpart to
+// ReadTelemetryFile and preserves any keys this package doesn't know about.
+func WriteTelemetryFile(path string, fields map[string]string) error {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", key, fields[key])
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0o600)
+}